@@ -7,18 +7,273 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Grazfather/zhl/highlight"
+	"github.com/dlclark/regexp2"
+	"golang.org/x/term"
 )
 
 const (
 	ansiEscape     = "\x1b"
 	ansiColorStart = "\x1b[38;5;%dm"
+	ansiTrueColor  = "\x1b[38;2;%d;%d;%dm"
 	ansiColorEnd   = "\x1b[0m"
 
 	outputBufferSize = 4 * 1024
 )
 
+// namedColors maps human-friendly color names to their 256-color palette
+// index, following the standard 16-color terminal layout (0-7 normal,
+// 8-15 bright).
+var namedColors = map[string]uint8{
+	"black":         0,
+	"red":           1,
+	"green":         2,
+	"yellow":        3,
+	"blue":          4,
+	"magenta":       5,
+	"cyan":          6,
+	"white":         7,
+	"brightblack":   8,
+	"brightred":     9,
+	"brightgreen":   10,
+	"brightyellow":  11,
+	"brightblue":    12,
+	"brightmagenta": 13,
+	"brightcyan":    14,
+	"brightwhite":   15,
+}
+
+// matcher abstracts the regex engine behind a single "find every match in
+// this line" operation, so the rest of the pipeline (span merging,
+// painting) doesn't care whether a pattern runs on RE2 or PCRE-style
+// regexp2. Each returned pair is a [start, end) byte range.
+type matcher interface {
+	FindAllIndex(line string) [][2]int
+}
+
+// re2Matcher runs patterns through the stdlib's RE2 engine: linear-time,
+// but unable to express lookaround or backreferences.
+type re2Matcher struct {
+	regex *regexp.Regexp
+}
+
+func (m re2Matcher) FindAllIndex(line string) [][2]int {
+	var spans [][2]int
+	for _, loc := range m.regex.FindAllStringIndex(line, -1) {
+		spans = append(spans, [2]int{loc[0], loc[1]})
+	}
+	return spans
+}
+
+// pcreMatcher runs patterns through regexp2, which supports lookaround,
+// backreferences and named-group recursion at the cost of RE2's
+// linear-time guarantee.
+type pcreMatcher struct {
+	regex *regexp2.Regexp
+}
+
+func (m pcreMatcher) FindAllIndex(line string) [][2]int {
+	// regexp2 reports positions as rune indices; offsets maps each rune
+	// index (plus the end of the line) to its byte offset.
+	var offsets []int
+	for i := range line {
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(line))
+
+	var spans [][2]int
+	match, err := m.regex.FindStringMatch(line)
+	for err == nil && match != nil {
+		spans = append(spans, [2]int{offsets[match.Index], offsets[match.Index+match.Length]})
+		match, err = m.regex.FindNextMatch(match)
+	}
+	return spans
+}
+
+func compileMatcher(pattern string, perl bool) (matcher, error) {
+	if perl {
+		regex, err := regexp2.Compile(pattern, regexp2.None)
+		if err != nil {
+			return nil, err
+		}
+		return pcreMatcher{regex: regex}, nil
+	}
+
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re2Matcher{regex: regex}, nil
+}
+
+// Pattern is a single named highlight rule: a compiled matcher paired
+// with the ANSI escape sequence used to colorize its matches.
+type Pattern struct {
+	Name      string
+	Matcher   matcher
+	ansiStart string
+}
+
+// compilePattern builds a Pattern, compiling pattern with the RE2 engine
+// or, when perl is set, the PCRE-style regexp2 engine.
+func compilePattern(name, pattern, colorSpec string, perl bool) (*Pattern, error) {
+	m, err := compileMatcher(pattern, perl)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse regex pattern %q: %v", pattern, err)
+	}
+
+	if name == "" {
+		name = pattern
+	}
+
+	ansiStart, err := resolveColor(colorSpec, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pattern{Name: name, Matcher: m, ansiStart: ansiStart}, nil
+}
+
+// patternSpec is a parsed, not-yet-compiled -p flag value. Compilation is
+// deferred until after flag.Parse() so that -P/--perl, which may appear
+// anywhere on the command line, is known before any pattern is compiled.
+type patternSpec struct {
+	name, pattern, colorSpec string
+}
+
+// patternList implements flag.Value so -p/-pattern can be repeated on the
+// command line to register multiple patterns.
+type patternList struct {
+	specs *[]patternSpec
+}
+
+func (p *patternList) String() string {
+	return ""
+}
+
+// Set parses a single -p flag value. Accepted forms:
+//
+//	regex                  auto-named, auto-assigned color
+//	name=regex             named, auto-assigned color
+//	regex:color            auto-named, explicit color
+//	name=regex:color       named, explicit color
+//
+// color is either a name from namedColors or a #rrggbb hex triplet; the
+// text after the last ':' is only treated as one if it actually resolves
+// to a known color, so patterns like `\d{2}:\d{2}:\d{2}` or `[[:digit:]]+`
+// aren't misparsed just because they contain ':'. A pattern that needs a
+// literal '=' or ':' of its own (which would otherwise be taken for the
+// name/color separator) can escape it as '\=' / '\:'.
+func (p *patternList) Set(value string) error {
+	name := ""
+	rest := value
+
+	if idx := unescapedIndex(rest, '='); idx >= 0 {
+		name = rest[:idx]
+		rest = rest[idx+1:]
+	}
+	rest = unescapeDelim(rest, '=')
+
+	colorSpec := ""
+	pattern := rest
+	if idx := unescapedLastIndex(rest, ':'); idx >= 0 {
+		if candidate := rest[idx+1:]; isColorSpec(candidate) {
+			pattern = rest[:idx]
+			colorSpec = candidate
+		}
+	}
+	pattern = unescapeDelim(pattern, ':')
+
+	*p.specs = append(*p.specs, patternSpec{name: name, pattern: pattern, colorSpec: colorSpec})
+	return nil
+}
+
+// unescapedIndex returns the index of the first occurrence of sep in s
+// that isn't immediately preceded by a backslash, or -1 if there is none.
+func unescapedIndex(s string, sep byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == sep && (i == 0 || s[i-1] != '\\') {
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapedLastIndex is like unescapedIndex, but returns the last match.
+func unescapedLastIndex(s string, sep byte) int {
+	last := -1
+	for i := 0; i < len(s); i++ {
+		if s[i] == sep && (i == 0 || s[i-1] != '\\') {
+			last = i
+		}
+	}
+	return last
+}
+
+// unescapeDelim turns an escaped delimiter ('\' followed by sep) into a
+// bare sep, once it's no longer a candidate for the name/color split.
+func unescapeDelim(s string, sep byte) string {
+	return strings.ReplaceAll(s, "\\"+string(sep), string(sep))
+}
+
+// isColorSpec reports whether spec resolves to a known color, i.e. a
+// #rrggbb hex triplet or a name from namedColors.
+func isColorSpec(spec string) bool {
+	if spec == "" {
+		return false
+	}
+	if strings.HasPrefix(spec, "#") {
+		_, _, _, err := parseHexColor(spec)
+		return err == nil
+	}
+	_, ok := namedColors[strings.ToLower(spec)]
+	return ok
+}
+
+// resolveColor turns a color spec (name, #rrggbb hex triplet, or empty for
+// an auto-assigned color derived from seed) into a ready-to-use ANSI start
+// escape sequence.
+func resolveColor(spec, seed string) (string, error) {
+	if spec == "" {
+		return fmt.Sprintf(ansiColorStart, getColor(seed)), nil
+	}
+
+	if strings.HasPrefix(spec, "#") {
+		r, g, b, err := parseHexColor(spec)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(ansiTrueColor, r, g, b), nil
+	}
+
+	if code, ok := namedColors[strings.ToLower(spec)]; ok {
+		return fmt.Sprintf(ansiColorStart, code), nil
+	}
+
+	return "", fmt.Errorf("unknown color %q", spec)
+}
+
+func parseHexColor(spec string) (r, g, b uint8, err error) {
+	hex := strings.TrimPrefix(spec, "#")
+	if len(hex) != 6 {
+		return 0, 0, 0, fmt.Errorf("invalid hex color %q: want #rrggbb", spec)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid hex color %q: %v", spec, err)
+	}
+
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), nil
+}
+
 type BufferedOutput struct {
 	buffer bytes.Buffer
 	writer io.Writer
@@ -55,48 +310,403 @@ func getColor(s string) uint8 {
 	return uint8(hash%200 + 16)
 }
 
-func colorizeLine(line string, regex *regexp.Regexp, grep, matchesOnly bool) (string, bool) {
-	var output bytes.Buffer
-	start := 0
-	matches := regex.FindAllStringSubmatchIndex(line, -1)
+// matchSpan is a single colorized interval within a line, already resolved
+// to the ANSI escape sequence that should wrap it.
+type matchSpan struct {
+	start, end int
+	ansiStart  string
+}
 
-	if len(matches) == 0 {
-		if grep {
-			return "", false
+// findSpans runs every pattern against line and returns the resulting
+// spans in declaration order (not yet merged).
+func findSpans(line string, patterns []*Pattern) []matchSpan {
+	var spans []matchSpan
+	for _, p := range patterns {
+		for _, match := range p.Matcher.FindAllIndex(line) {
+			spans = append(spans, matchSpan{start: match[0], end: match[1], ansiStart: p.ansiStart})
+		}
+	}
+	return spans
+}
+
+// mergeSpans resolves overlaps between spans from different patterns and
+// returns a non-overlapping, start-sorted slice. By default the
+// first-declared pattern wins an overlap; with longestMatch set, the
+// longer of the two overlapping spans wins instead.
+func mergeSpans(spans []matchSpan, longestMatch bool) []matchSpan {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	// ordered holds indices into spans; since findSpans emits spans in
+	// declaration order, a lower index means an earlier-declared pattern.
+	ordered := make([]int, len(spans))
+	for i := range ordered {
+		ordered[i] = i
+	}
+
+	less := func(i, j int) bool { return spans[ordered[i]].start < spans[ordered[j]].start }
+	// Simple insertion sort: pattern/match counts per line are tiny.
+	for i := 1; i < len(ordered); i++ {
+		for j := i; j > 0 && less(j, j-1); j-- {
+			ordered[j], ordered[j-1] = ordered[j-1], ordered[j]
 		}
-		return line, true
 	}
 
-	for _, match := range matches {
-		matchStart, matchEnd := match[0], match[1]
-		matchText := line[matchStart:matchEnd]
-		color := getColor(matchText)
+	var merged []matchSpan
+	var rank []int // index in spans of the span whose color each merged entry uses
+	for _, idx := range ordered {
+		span := spans[idx]
+		if len(merged) == 0 || span.start >= merged[len(merged)-1].end {
+			merged = append(merged, span)
+			rank = append(rank, idx)
+			continue
+		}
+
+		last := &merged[len(merged)-1]
+
+		// Overlap: keep whichever span wins, first-declared by default.
+		if longestMatch && (span.end-span.start) > (last.end-last.start) {
+			*last = span
+		}
+		if !longestMatch && idx < rank[len(rank)-1] {
+			last.ansiStart = span.ansiStart
+			rank[len(rank)-1] = idx
+		}
+		if span.end > last.end && !longestMatch {
+			last.end = span.end
+		}
+	}
+	return merged
+}
 
+// paintSpans is the shared span-painter: it wraps each span in its ANSI
+// color and stitches the untouched text back in between, used by both
+// the flat pattern engine and the stateful syntax engine.
+func paintSpans(line string, spans []matchSpan, matchesOnly, color bool) string {
+	var output bytes.Buffer
+	start := 0
+	for _, span := range spans {
 		if !matchesOnly {
-			output.WriteString(line[start:matchStart])
+			output.WriteString(line[start:span.start])
+		}
+		if color {
+			output.WriteString(span.ansiStart)
 		}
-		fmt.Fprintf(&output, ansiColorStart, color)
-		output.WriteString(matchText)
-		output.WriteString(ansiColorEnd)
-		start = matchEnd
+		output.WriteString(line[span.start:span.end])
+		if color {
+			output.WriteString(ansiColorEnd)
+		}
+		start = span.end
 	}
 
 	if !matchesOnly {
 		output.WriteString(line[start:])
 	}
+	return output.String()
+}
+
+// colorizeLine renders line with every matching pattern span painted, and
+// reports whether anything matched. Filtering non-matching lines out of
+// the output (grep mode) is the caller's job, since context mode still
+// needs access to unmatched lines.
+func colorizeLine(line string, patterns []*Pattern, matchesOnly, longestMatch, color bool) (string, bool) {
+	spans := mergeSpans(findSpans(line, patterns), longestMatch)
+
+	if len(spans) == 0 {
+		if matchesOnly {
+			return "", false
+		}
+		return line, false
+	}
+
+	return paintSpans(line, spans, matchesOnly, color), true
+}
+
+// ansiTokenRegex recognizes pre-existing ANSI escape sequences in input
+// that's already been colorized upstream (e.g. by kubectl, cargo, go
+// test): CSI sequences like "\x1b[1;31m", and OSC 8 hyperlinks like
+// "\x1b]8;;https://example.com\x1b\\".
+var ansiTokenRegex = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]|\x1b\]8;;[^\x07\x1b]*(?:\x07|\x1b\\)`)
+
+// ansiToken is either a run of visible text or a pre-existing escape
+// sequence, in the order they appeared in the original line.
+type ansiToken struct {
+	text     string
+	isEscape bool
+}
+
+// tokenizeANSI splits line into an ordered sequence of visible-text and
+// escape-sequence tokens.
+func tokenizeANSI(line string) []ansiToken {
+	var tokens []ansiToken
+	last := 0
+	for _, loc := range ansiTokenRegex.FindAllStringIndex(line, -1) {
+		if loc[0] > last {
+			tokens = append(tokens, ansiToken{text: line[last:loc[0]]})
+		}
+		tokens = append(tokens, ansiToken{text: line[loc[0]:loc[1]], isEscape: true})
+		last = loc[1]
+	}
+	if last < len(line) {
+		tokens = append(tokens, ansiToken{text: line[last:]})
+	}
+	return tokens
+}
+
+// visibleText concatenates every non-escape token, giving the text
+// patterns should actually match against.
+func visibleText(tokens []ansiToken) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		if !t.isEscape {
+			b.WriteString(t.text)
+		}
+	}
+	return b.String()
+}
+
+// isSGR reports whether an escape token is an SGR (Select Graphic
+// Rendition) sequence, i.e. one that changes text style rather than e.g.
+// moving the cursor.
+func isSGR(escape string) bool {
+	return strings.HasPrefix(escape, "\x1b[") && strings.HasSuffix(escape, "m")
+}
+
+// colorizeANSIAwareLine matches patterns only against line's visible
+// text, then re-emits line with its original escape sequences preserved
+// verbatim and new highlight sequences wrapped around matches. Ending a
+// highlight restores whatever SGR style was active immediately before
+// it, rather than resetting to plain text, so highlighting doesn't erase
+// a tool's own colors.
+func colorizeANSIAwareLine(line string, patterns []*Pattern, matchesOnly, longestMatch, color bool) (string, bool) {
+	tokens := tokenizeANSI(line)
+	spans := mergeSpans(findSpans(visibleText(tokens), patterns), longestMatch)
+
+	if len(spans) == 0 {
+		if matchesOnly {
+			return "", false
+		}
+		return line, false
+	}
+
+	var output strings.Builder
+	visiblePos := 0
+	spanIdx := 0
+	inSpan := false
+	activeStyle := ""
+
+	closeSpan := func() {
+		if color {
+			output.WriteString(ansiColorEnd)
+			if !matchesOnly {
+				output.WriteString(activeStyle)
+			}
+		}
+		inSpan = false
+		spanIdx++
+	}
+
+	for _, tok := range tokens {
+		if tok.isEscape {
+			if isSGR(tok.text) {
+				if tok.text == ansiColorEnd {
+					activeStyle = ""
+				} else {
+					activeStyle += tok.text
+				}
+			}
+
+			// Outside a kept span this escape only decorates text that's
+			// being dropped in matchesOnly mode, so drop it too instead
+			// of leaving an orphaned style code behind.
+			if matchesOnly && !inSpan {
+				continue
+			}
+
+			output.WriteString(tok.text)
+			if inSpan && color && isSGR(tok.text) {
+				// The original stream just reset or re-styled, which
+				// would end our highlight early; reassert it so the
+				// span stays highlighted through to its real end.
+				output.WriteString(spans[spanIdx].ansiStart)
+			}
+			continue
+		}
+
+		text := tok.text
+		pos := 0
+		for pos < len(text) {
+			abs := visiblePos + pos
+
+			for spanIdx < len(spans) && spans[spanIdx].end <= abs {
+				spanIdx++
+			}
+
+			if spanIdx < len(spans) && spans[spanIdx].start <= abs {
+				if !inSpan {
+					if color {
+						output.WriteString(spans[spanIdx].ansiStart)
+					}
+					inSpan = true
+				}
+
+				end := spans[spanIdx].end - visiblePos
+				if end > len(text) {
+					end = len(text)
+				}
+				output.WriteString(text[pos:end])
+				pos = end
+
+				if visiblePos+pos >= spans[spanIdx].end {
+					closeSpan()
+				}
+				continue
+			}
+
+			boundary := len(text)
+			if spanIdx < len(spans) && spans[spanIdx].start-visiblePos < boundary {
+				boundary = spans[spanIdx].start - visiblePos
+			}
+			if !matchesOnly {
+				output.WriteString(text[pos:boundary])
+			}
+			pos = boundary
+		}
+		visiblePos += len(text)
+	}
+
+	if inSpan {
+		closeSpan()
+	}
+
 	return output.String(), true
 }
 
-func process(reader io.Reader, writer io.Writer, regex *regexp.Regexp, grep, matchesOnly bool) error {
+// groupColors resolves every group name a syntax definition references to
+// a ready-to-use ANSI escape sequence, computed once up front so process
+// doesn't re-resolve colors on every line. A group name is first tried as
+// a color spec (named color or #rrggbb); if that fails, it falls back to
+// an auto-assigned color hashed from the group name itself.
+func groupColors(syntax *highlight.Syntax) map[string]string {
+	colors := make(map[string]string)
+
+	add := func(group string) {
+		if group == "" {
+			return
+		}
+		if _, ok := colors[group]; ok {
+			return
+		}
+		ansiStart, err := resolveColor(group, group)
+		if err != nil {
+			ansiStart, _ = resolveColor("", group)
+		}
+		colors[group] = ansiStart
+	}
+
+	for _, m := range syntax.Matches {
+		add(m.Group)
+	}
+	for _, r := range syntax.Regions {
+		add(r.Group)
+	}
+	return colors
+}
+
+func colorizeSyntaxLine(line string, syntax *highlight.Syntax, state *highlight.State, colors map[string]string, matchesOnly, color bool) (string, bool, *highlight.State) {
+	hlSpans, state := syntax.Highlight(line, state)
+
+	if len(hlSpans) == 0 {
+		if matchesOnly {
+			return "", false, state
+		}
+		return line, false, state
+	}
+
+	spans := make([]matchSpan, len(hlSpans))
+	for i, s := range hlSpans {
+		spans[i] = matchSpan{start: s.Start, end: s.End, ansiStart: colors[s.Group]}
+	}
+	return paintSpans(line, spans, matchesOnly, color), true, state
+}
+
+// renderLine dispatches a single line to the right engine: ANSI-aware
+// mode (which only understands flat patterns, not stateful syntax
+// files), stateful syntax highlighting, or plain flat-pattern matching.
+func renderLine(line string, patterns []*Pattern, syntax *highlight.Syntax, state *highlight.State, colors map[string]string, matchesOnly, longestMatch, ansiAware, color bool) (string, bool, *highlight.State) {
+	if ansiAware {
+		rendered, matched := colorizeANSIAwareLine(line, patterns, matchesOnly, longestMatch, color)
+		return rendered, matched, state
+	}
+	if syntax != nil {
+		return colorizeSyntaxLine(line, syntax, state, colors, matchesOnly, color)
+	}
+	rendered, matched := colorizeLine(line, patterns, matchesOnly, longestMatch, color)
+	return rendered, matched, state
+}
+
+// process streams reader to writer line by line. In grep mode, before and
+// after control how many lines of context surround each match are kept:
+// before lines are buffered in a ring and flushed once a match is found,
+// after lines are emitted unconditionally for the given count following
+// a match.
+func process(reader io.Reader, writer io.Writer, patterns []*Pattern, syntax *highlight.Syntax, grep, matchesOnly, longestMatch, ansiAware, color bool, before, after int, prefix string) error {
 	bufferedOutput := NewBufferedOutput(writer)
 	scanner := bufio.NewScanner(reader)
 
+	var state *highlight.State
+	var colors map[string]string
+	if syntax != nil {
+		state = highlight.NewState()
+		colors = groupColors(syntax)
+	}
+
+	emit := func(line string) error {
+		if prefix != "" {
+			line = prefix + line
+		}
+		return bufferedOutput.Append(line)
+	}
+
+	var ring []string
+	afterRemaining := 0
+
 	for scanner.Scan() {
 		line := scanner.Text()
-		if colorized, ok := colorizeLine(line, regex, grep, matchesOnly); ok {
-			if err := bufferedOutput.Append(colorized); err != nil {
+
+		colorized, matched, newState := renderLine(line, patterns, syntax, state, colors, matchesOnly, longestMatch, ansiAware, color)
+		state = newState
+
+		if !grep {
+			if err := emit(colorized); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch {
+		case matched:
+			for _, context := range ring {
+				if err := emit(context); err != nil {
+					return err
+				}
+			}
+			ring = ring[:0]
+			if err := emit(colorized); err != nil {
 				return err
 			}
+			afterRemaining = after
+		case afterRemaining > 0:
+			afterRemaining--
+			if err := emit(colorized); err != nil {
+				return err
+			}
+		case before > 0:
+			ring = append(ring, colorized)
+			if len(ring) > before {
+				ring = ring[1:]
+			}
 		}
 	}
 
@@ -107,21 +717,158 @@ func process(reader io.Reader, writer io.Writer, regex *regexp.Regexp, grep, mat
 	return bufferedOutput.Flush()
 }
 
+// processGroups implements --print-group: every line whose groupRegex
+// capture matches the same value as a matching line is printed, not just
+// the matching line itself. This needs the whole input in hand, so it
+// runs in two passes: first recording which group ids had a match,
+// then emitting every line belonging to a wanted group.
+func processGroups(reader io.Reader, writer io.Writer, patterns []*Pattern, syntax *highlight.Syntax, matchesOnly, longestMatch, ansiAware, color bool, groupRegex *regexp.Regexp, prefix string) error {
+	scanner := bufio.NewScanner(reader)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	var state *highlight.State
+	var colors map[string]string
+	if syntax != nil {
+		state = highlight.NewState()
+		colors = groupColors(syntax)
+	}
+
+	rendered := make([]string, len(lines))
+	groupOf := make([]string, len(lines))
+	wanted := make(map[string]bool)
+
+	for i, line := range lines {
+		colorized, matched, newState := renderLine(line, patterns, syntax, state, colors, matchesOnly, longestMatch, ansiAware, color)
+		state = newState
+		rendered[i] = colorized
+
+		if groups := groupRegex.FindStringSubmatch(line); len(groups) > 1 {
+			groupOf[i] = groups[1]
+			if matched {
+				wanted[groups[1]] = true
+			}
+		}
+	}
+
+	bufferedOutput := NewBufferedOutput(writer)
+	for i, id := range groupOf {
+		if id == "" || !wanted[id] {
+			continue
+		}
+		line := rendered[i]
+		if prefix != "" {
+			line = prefix + line
+		}
+		if err := bufferedOutput.Append(line); err != nil {
+			return err
+		}
+	}
+
+	return bufferedOutput.Flush()
+}
+
+// collectFiles expands targets (files, directories, or the "-" stdin
+// sentinel) into a flat list of file paths to process. Directories
+// require recursive to be set, and are walked with filepath.WalkDir;
+// include/exclude are glob patterns (filepath.Match) tested against each
+// file's base name.
+func collectFiles(targets []string, recursive bool, include, exclude string) ([]string, error) {
+	var files []string
+
+	for _, target := range targets {
+		if target == "-" {
+			files = append(files, "-")
+			continue
+		}
+
+		info, err := os.Stat(target)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, target)
+			continue
+		}
+
+		if !recursive {
+			return nil, fmt.Errorf("%s: is a directory", target)
+		}
+
+		err = filepath.WalkDir(target, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if fileMatches(path, include, exclude) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// fileMatches reports whether path should be included given optional
+// include/exclude glob patterns matched against its base name. An empty
+// pattern imposes no constraint.
+func fileMatches(path, include, exclude string) bool {
+	base := filepath.Base(path)
+
+	if exclude != "" {
+		if matched, _ := filepath.Match(exclude, base); matched {
+			return false
+		}
+	}
+
+	if include != "" {
+		matched, _ := filepath.Match(include, base)
+		return matched
+	}
+
+	return true
+}
+
 func main() {
 	var (
 		help           bool
-		pattern        string
+		specs          []patternSpec
+		syntaxPath     string
 		decimalNumbers bool
 		words          bool
 		hexNumbers     bool
 		grep           bool
 		matchesOnly    bool
+		longestMatch   bool
+		recursive      bool
+		include        string
+		exclude        string
+		contextAfter   int
+		contextBefore  int
+		contextBoth    int
+		printGroup     string
+		perl           bool
+		ansiAware      bool
+		noColor        bool
 	)
 
 	flag.BoolVar(&help, "h", false, "Display this help and exit")
 	flag.BoolVar(&help, "help", false, "Display this help and exit")
-	flag.StringVar(&pattern, "p", "", "Regex pattern to highlight")
-	flag.StringVar(&pattern, "pattern", "", "Regex pattern to highlight")
+	flag.Var(&patternList{&specs}, "p", "Regex pattern to highlight, repeatable: name=regex:color")
+	flag.Var(&patternList{&specs}, "pattern", "Regex pattern to highlight, repeatable: name=regex:color")
+	flag.StringVar(&syntaxPath, "syntax", "", "Load a YAML syntax definition for stateful multi-line highlighting")
 	flag.BoolVar(&decimalNumbers, "d", false, "Highlight decimal digits")
 	flag.BoolVar(&decimalNumbers, "decimalnumbers", false, "Highlight decimal digits")
 	flag.BoolVar(&words, "w", false, "Highlight (regex) words")
@@ -132,6 +879,19 @@ func main() {
 	flag.BoolVar(&grep, "grep", false, "Only print matching lines")
 	flag.BoolVar(&matchesOnly, "m", false, "Only print matches")
 	flag.BoolVar(&matchesOnly, "matchesonly", false, "Only print matches")
+	flag.BoolVar(&longestMatch, "longest-match", false, "On overlap, prefer the longest match instead of the first-declared pattern")
+	flag.BoolVar(&recursive, "r", false, "Recurse into directories given as arguments")
+	flag.BoolVar(&recursive, "recursive", false, "Recurse into directories given as arguments")
+	flag.StringVar(&include, "include", "", "When recursing, only process files whose name matches this glob")
+	flag.StringVar(&exclude, "exclude", "", "When recursing, skip files whose name matches this glob")
+	flag.IntVar(&contextAfter, "A", 0, "Grep mode: print N lines of context after each match")
+	flag.IntVar(&contextBefore, "B", 0, "Grep mode: print N lines of context before each match")
+	flag.IntVar(&contextBoth, "C", 0, "Grep mode: print N lines of context before and after each match")
+	flag.StringVar(&printGroup, "print-group", "", "Grep mode: print every line whose capture group matches that of a matching line")
+	flag.BoolVar(&perl, "P", false, "Use a PCRE-style engine (lookaround, backreferences) instead of RE2")
+	flag.BoolVar(&perl, "perl", false, "Use a PCRE-style engine (lookaround, backreferences) instead of RE2")
+	flag.BoolVar(&ansiAware, "ansi-aware", false, "Match only visible text in already-colorized input, preserving its escape sequences")
+	flag.BoolVar(&noColor, "no-color", false, "Disable color output")
 
 	flag.Parse()
 
@@ -140,24 +900,39 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Determine the pattern to use
+	var syntax *highlight.Syntax
+	if syntaxPath != "" {
+		var err error
+		syntax, err = highlight.Load(syntaxPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot load syntax: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var patterns []*Pattern
+	for _, spec := range specs {
+		pattern, err := compilePattern(spec.name, spec.pattern, spec.colorSpec, perl)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	// Built-in shorthand patterns behave like any other -p pattern, appended
+	// after any explicit ones so explicit patterns still win overlaps.
 	switch {
-	case pattern != "":
-		// Use provided pattern
 	case decimalNumbers:
-		pattern = `\b\d+\b`
+		patterns = append(patterns, mustPattern("decimal", `\b\d+\b`, perl))
 	case words:
-		pattern = `\w+`
+		patterns = append(patterns, mustPattern("words", `\w+`, perl))
 	case hexNumbers:
-		pattern = `0x[a-fA-F0-9]{2,}|[a-fA-F0-9]{2,}`
-	default:
-		flag.Usage()
-		os.Exit(1)
+		patterns = append(patterns, mustPattern("hex", `0x[a-fA-F0-9]{2,}|[a-fA-F0-9]{2,}`, perl))
 	}
 
-	regex, err := regexp.Compile(pattern)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Cannot parse regex pattern '%s': %v\n", pattern, err)
+	if len(patterns) == 0 && syntax == nil {
+		flag.Usage()
 		os.Exit(1)
 	}
 
@@ -165,8 +940,96 @@ func main() {
 		grep = true
 	}
 
-	if err := process(os.Stdin, os.Stdout, regex, grep, matchesOnly); err != nil {
-		fmt.Fprintf(os.Stderr, "Error processing input: %v\n", err)
+	before, after := contextBefore, contextAfter
+	if contextBoth > 0 {
+		before, after = contextBoth, contextBoth
+	}
+
+	var groupRegex *regexp.Regexp
+	if grep && printGroup != "" {
+		var err error
+		groupRegex, err = regexp.Compile(printGroup)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot parse -print-group pattern %q: %v\n", printGroup, err)
+			os.Exit(1)
+		}
+	}
+
+	color := shouldColorize(noColor)
+
+	targets := flag.Args()
+	if len(targets) == 0 {
+		targets = []string{"-"}
+	}
+
+	files, err := collectFiles(targets, recursive, include, exclude)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
+
+	showPrefix := len(files) > 1
+	exitCode := 0
+
+	for _, name := range files {
+		reader, err := openInput(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			exitCode = 1
+			continue
+		}
+
+		prefix := ""
+		if showPrefix {
+			prefix = name + ":"
+		}
+
+		if groupRegex != nil {
+			err = processGroups(reader, os.Stdout, patterns, syntax, matchesOnly, longestMatch, ansiAware, color, groupRegex, prefix)
+		} else {
+			err = process(reader, os.Stdout, patterns, syntax, grep, matchesOnly, longestMatch, ansiAware, color, before, after, prefix)
+		}
+		if name != "-" {
+			reader.(io.Closer).Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", name, err)
+			exitCode = 1
+		}
+	}
+
+	os.Exit(exitCode)
+}
+
+// openInput opens name for reading, treating the "-" sentinel as stdin.
+func openInput(name string) (io.Reader, error) {
+	if name == "-" {
+		return os.Stdin, nil
+	}
+	return os.Open(name)
+}
+
+// shouldColorize decides whether to emit ANSI escapes at all, honoring
+// (in order of precedence) an explicit -no-color flag, the NO_COLOR
+// convention, CLICOLOR_FORCE, and finally whether stdout is actually a
+// terminal.
+func shouldColorize(noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return true
+	}
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// mustPattern builds a Pattern for one of the built-in shorthand flags
+// (-d/-w/-x); the regexes are fixed at compile time so a failure here is a
+// programmer error, not user input.
+func mustPattern(name, pattern string, perl bool) *Pattern {
+	p, err := compilePattern(name, pattern, "", perl)
+	if err != nil {
+		panic(err)
+	}
+	return p
 }
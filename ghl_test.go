@@ -0,0 +1,333 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPatternListSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  patternSpec
+	}{
+		{
+			name:  "bare pattern",
+			value: `\d+`,
+			want:  patternSpec{pattern: `\d+`},
+		},
+		{
+			name:  "named pattern",
+			value: `count=\d+`,
+			want:  patternSpec{name: "count", pattern: `\d+`},
+		},
+		{
+			name:  "pattern with explicit color",
+			value: `\d+:red`,
+			want:  patternSpec{pattern: `\d+`, colorSpec: "red"},
+		},
+		{
+			name:  "named pattern with explicit color",
+			value: `count=\d+:red`,
+			want:  patternSpec{name: "count", pattern: `\d+`, colorSpec: "red"},
+		},
+		{
+			name:  "trailing colons that aren't a color are left in the pattern",
+			value: `\d{2}:\d{2}:\d{2}`,
+			want:  patternSpec{pattern: `\d{2}:\d{2}:\d{2}`},
+		},
+		{
+			name:  "POSIX bracket expression isn't mistaken for name=color",
+			value: `[[:digit:]]+`,
+			want:  patternSpec{pattern: `[[:digit:]]+`},
+		},
+		{
+			name:  "ordinary key=value grep pattern without an intended name",
+			value: `key\=value`,
+			want:  patternSpec{pattern: `key=value`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var specs []patternSpec
+			p := patternList{specs: &specs}
+			if err := p.Set(tt.value); err != nil {
+				t.Fatalf("Set(%q) returned error: %v", tt.value, err)
+			}
+			if len(specs) != 1 {
+				t.Fatalf("Set(%q) produced %d specs, want 1", tt.value, len(specs))
+			}
+			if specs[0] != tt.want {
+				t.Fatalf("Set(%q) = %+v, want %+v", tt.value, specs[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeSpansNonOverlapping(t *testing.T) {
+	spans := []matchSpan{
+		{start: 5, end: 10, ansiStart: "b"},
+		{start: 0, end: 3, ansiStart: "a"},
+	}
+	got := mergeSpans(spans, false)
+	want := []matchSpan{
+		{start: 0, end: 3, ansiStart: "a"},
+		{start: 5, end: 10, ansiStart: "b"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mergeSpans = %+v, want %+v", got, want)
+	}
+}
+
+func TestMergeSpansOverlapFirstDeclaredWins(t *testing.T) {
+	spans := []matchSpan{
+		{start: 0, end: 5, ansiStart: "a"},
+		{start: 2, end: 8, ansiStart: "b"},
+	}
+	got := mergeSpans(spans, false)
+	want := []matchSpan{{start: 0, end: 8, ansiStart: "a"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mergeSpans = %+v, want %+v", got, want)
+	}
+}
+
+func TestMergeSpansOverlapLongestWins(t *testing.T) {
+	spans := []matchSpan{
+		{start: 0, end: 5, ansiStart: "a"},
+		{start: 2, end: 8, ansiStart: "b"},
+	}
+	got := mergeSpans(spans, true)
+	want := []matchSpan{{start: 2, end: 8, ansiStart: "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mergeSpans = %+v, want %+v", got, want)
+	}
+}
+
+func TestTokenizeANSI(t *testing.T) {
+	tokens := tokenizeANSI("\x1b[32mok \x1b[0mERROR")
+	want := []ansiToken{
+		{text: "\x1b[32m", isEscape: true},
+		{text: "ok "},
+		{text: "\x1b[0m", isEscape: true},
+		{text: "ERROR"},
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Fatalf("tokenizeANSI = %+v, want %+v", tokens, want)
+	}
+}
+
+func TestTokenizeANSINoEscapes(t *testing.T) {
+	tokens := tokenizeANSI("plain text")
+	want := []ansiToken{{text: "plain text"}}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Fatalf("tokenizeANSI = %+v, want %+v", tokens, want)
+	}
+}
+
+func TestColorizeANSIAwareLineReassertsAcrossEmbeddedReset(t *testing.T) {
+	pat, err := compilePattern("", "foobar", "red", false)
+	if err != nil {
+		t.Fatalf("compilePattern: %v", err)
+	}
+
+	// A reset embedded inside the match (as e.g. go test emits around
+	// each colored token) must not end the highlight early.
+	got, matched := colorizeANSIAwareLine("foo\x1b[0mbar", []*Pattern{pat}, false, false, true)
+	if !matched {
+		t.Fatal("expected a match")
+	}
+	want := "\x1b[38;5;1mfoo\x1b[0m\x1b[38;5;1mbar\x1b[0m"
+	if got != want {
+		t.Fatalf("colorizeANSIAwareLine = %q, want %q", got, want)
+	}
+}
+
+func TestColorizeANSIAwareLineMatchesOnlyDropsOrphanedEscapes(t *testing.T) {
+	pat, err := compilePattern("", "ERROR", "red", false)
+	if err != nil {
+		t.Fatalf("compilePattern: %v", err)
+	}
+
+	got, matched := colorizeANSIAwareLine(
+		"\x1b[32mok \x1b[0mERROR\x1b[33m thing\x1b[0m",
+		[]*Pattern{pat}, true, false, true,
+	)
+	if !matched {
+		t.Fatal("expected a match")
+	}
+	want := "\x1b[38;5;1mERROR\x1b[0m"
+	if got != want {
+		t.Fatalf("colorizeANSIAwareLine = %q, want %q", got, want)
+	}
+}
+
+func TestColorizeANSIAwareLineNoMatch(t *testing.T) {
+	pat, err := compilePattern("", "nope", "red", false)
+	if err != nil {
+		t.Fatalf("compilePattern: %v", err)
+	}
+
+	got, matched := colorizeANSIAwareLine("\x1b[32mok\x1b[0m", []*Pattern{pat}, false, false, true)
+	if matched {
+		t.Fatal("expected no match")
+	}
+	if got != "\x1b[32mok\x1b[0m" {
+		t.Fatalf("colorizeANSIAwareLine = %q, want original line unchanged", got)
+	}
+}
+
+func TestCompileMatcherRE2(t *testing.T) {
+	m, err := compileMatcher(`\d+`, false)
+	if err != nil {
+		t.Fatalf("compileMatcher: %v", err)
+	}
+	got := m.FindAllIndex("a1 b22 c333")
+	want := [][2]int{{1, 2}, {4, 6}, {8, 11}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FindAllIndex = %v, want %v", got, want)
+	}
+}
+
+func TestCompileMatcherPCRE(t *testing.T) {
+	// (?<=a)b is a lookbehind, unsupported by RE2 but fine under regexp2.
+	m, err := compileMatcher(`(?<=a)b`, true)
+	if err != nil {
+		t.Fatalf("compileMatcher: %v", err)
+	}
+	got := m.FindAllIndex("ab cb ab")
+	want := [][2]int{{1, 2}, {7, 8}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FindAllIndex = %v, want %v", got, want)
+	}
+}
+
+func TestCompileMatcherPCREZeroLengthMatches(t *testing.T) {
+	m, err := compileMatcher(`a*`, true)
+	if err != nil {
+		t.Fatalf("compileMatcher: %v", err)
+	}
+	got := m.FindAllIndex("baa")
+	want := [][2]int{{0, 0}, {1, 3}, {3, 3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FindAllIndex = %v, want %v", got, want)
+	}
+}
+
+func TestFileMatches(t *testing.T) {
+	tests := []struct {
+		name             string
+		path             string
+		include, exclude string
+		want             bool
+	}{
+		{name: "no filters", path: "a/b.go", want: true},
+		{name: "include matches", path: "a/b.go", include: "*.go", want: true},
+		{name: "include doesn't match", path: "a/b.txt", include: "*.go", want: false},
+		{name: "exclude matches", path: "a/b.go", exclude: "*.go", want: false},
+		{name: "exclude wins over include", path: "a/b.go", include: "*.go", exclude: "*.go", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fileMatches(tt.path, tt.include, tt.exclude)
+			if got != tt.want {
+				t.Fatalf("fileMatches(%q, %q, %q) = %v, want %v", tt.path, tt.include, tt.exclude, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("text"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "c.go"), []byte("package c"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("stdin sentinel", func(t *testing.T) {
+		got, err := collectFiles([]string{"-"}, false, "", "")
+		if err != nil {
+			t.Fatalf("collectFiles: %v", err)
+		}
+		if !reflect.DeepEqual(got, []string{"-"}) {
+			t.Fatalf("collectFiles = %v, want [-]", got)
+		}
+	})
+
+	t.Run("directory without recursive errors", func(t *testing.T) {
+		if _, err := collectFiles([]string{dir}, false, "", ""); err == nil {
+			t.Fatal("expected an error for a directory without -recursive")
+		}
+	})
+
+	t.Run("recursive walk filtered by include", func(t *testing.T) {
+		got, err := collectFiles([]string{dir}, true, "*.go", "")
+		if err != nil {
+			t.Fatalf("collectFiles: %v", err)
+		}
+		var bases []string
+		for _, f := range got {
+			bases = append(bases, filepath.Base(f))
+		}
+		want := []string{"a.go", "c.go"}
+		if !reflect.DeepEqual(bases, want) {
+			t.Fatalf("collectFiles bases = %v, want %v", bases, want)
+		}
+	})
+}
+
+func TestProcessGrepContext(t *testing.T) {
+	pat, err := compilePattern("", "ERROR", "red", false)
+	if err != nil {
+		t.Fatalf("compilePattern: %v", err)
+	}
+
+	input := "line1\nline2\nERROR here\nline4\nline5\n"
+	var out strings.Builder
+	err = process(strings.NewReader(input), &out, []*Pattern{pat}, nil,
+		true /* grep */, false, false, false, false, /* color off to keep output plain */
+		1 /* before */, 1 /* after */, "")
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	want := "line2\nERROR here\nline4\n"
+	if out.String() != want {
+		t.Fatalf("process output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestProcessGroupsPrintGroup(t *testing.T) {
+	pat, err := compilePattern("", "ERROR", "red", false)
+	if err != nil {
+		t.Fatalf("compilePattern: %v", err)
+	}
+	groupRegex := regexp.MustCompile(`^\[(\w+)\]`)
+
+	input := "[req1] start\n[req2] start\n[req1] ERROR boom\n[req2] ok\n[req1] end\n"
+	var out strings.Builder
+	err = processGroups(strings.NewReader(input), &out, []*Pattern{pat}, nil,
+		false, false, false, false, groupRegex, "")
+	if err != nil {
+		t.Fatalf("processGroups: %v", err)
+	}
+
+	want := "[req1] start\n[req1] ERROR boom\n[req1] end\n"
+	if out.String() != want {
+		t.Fatalf("processGroups output = %q, want %q", out.String(), want)
+	}
+}
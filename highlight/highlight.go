@@ -0,0 +1,315 @@
+// Package highlight implements stateful, syntax-definition-driven
+// highlighting of text a line at a time. It is the engine behind zhl's
+// -syntax flag: unlike a flat regex pass, it can keep multi-line
+// constructs (block comments, triple-quoted strings, heredocs, ...)
+// colored across newlines by threading a State value through successive
+// calls to Highlight.
+package highlight
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Span is a single colorized interval within a line. Group names the
+// syntax group the span belongs to (e.g. "comment", "string"); callers
+// are responsible for turning that into an actual color.
+type Span struct {
+	Start, End int
+	Group      string
+}
+
+// MatchRule highlights every occurrence of Regex with Group, entirely
+// within a single line.
+type MatchRule struct {
+	Regex *regexp.Regexp
+	Group string
+}
+
+// RegionRule highlights everything between a Start and End match (e.g.
+// `/*` ... `*/`) with Group, possibly spanning multiple lines. Skip, if
+// set, lets an End-like sequence appear escaped inside the region (e.g.
+// `\"` inside a quoted string) without closing it.
+type RegionRule struct {
+	Name  string
+	Start *regexp.Regexp
+	End   *regexp.Regexp
+	Skip  *regexp.Regexp
+	Group string
+}
+
+// Syntax is a full rule set loaded from a YAML file.
+type Syntax struct {
+	Name    string
+	Matches []MatchRule
+	Regions []RegionRule
+}
+
+// State carries the stack of currently open regions from one line to the
+// next. The zero value is a valid "nothing open" state.
+type State struct {
+	stack []*RegionRule
+}
+
+// NewState returns a fresh State with no open regions.
+func NewState() *State {
+	return &State{}
+}
+
+func (s *State) top() *RegionRule {
+	if len(s.stack) == 0 {
+		return nil
+	}
+	return s.stack[len(s.stack)-1]
+}
+
+func (s *State) push(r *RegionRule) {
+	s.stack = append(s.stack, r)
+}
+
+func (s *State) pop() {
+	s.stack = s.stack[:len(s.stack)-1]
+}
+
+type yamlSyntax struct {
+	Name  string     `yaml:"name"`
+	Rules []yamlRule `yaml:"rules"`
+}
+
+type yamlRule struct {
+	Match  string      `yaml:"match"`
+	Group  string      `yaml:"group"`
+	Region *yamlRegion `yaml:"region"`
+}
+
+type yamlRegion struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+	Skip  string `yaml:"skip"`
+	Group string `yaml:"group"`
+}
+
+// Load reads and compiles a syntax definition from a YAML file.
+func Load(path string) (*Syntax, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading syntax file %q: %v", path, err)
+	}
+
+	var raw yamlSyntax
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing syntax file %q: %v", path, err)
+	}
+
+	syntax := &Syntax{Name: raw.Name}
+	for _, rule := range raw.Rules {
+		switch {
+		case rule.Region != nil:
+			region, err := compileRegion(rule.Region)
+			if err != nil {
+				return nil, fmt.Errorf("syntax file %q: %v", path, err)
+			}
+			syntax.Regions = append(syntax.Regions, *region)
+		case rule.Match != "":
+			regex, err := regexp.Compile(rule.Match)
+			if err != nil {
+				return nil, fmt.Errorf("syntax file %q: match %q: %v", path, rule.Match, err)
+			}
+			syntax.Matches = append(syntax.Matches, MatchRule{Regex: regex, Group: rule.Group})
+		default:
+			return nil, fmt.Errorf("syntax file %q: rule has neither match nor region", path)
+		}
+	}
+	return syntax, nil
+}
+
+func compileRegion(r *yamlRegion) (*RegionRule, error) {
+	start, err := regexp.Compile(r.Start)
+	if err != nil {
+		return nil, fmt.Errorf("region start %q: %v", r.Start, err)
+	}
+	end, err := regexp.Compile(r.End)
+	if err != nil {
+		return nil, fmt.Errorf("region end %q: %v", r.End, err)
+	}
+
+	var skip *regexp.Regexp
+	if r.Skip != "" {
+		skip, err = regexp.Compile(r.Skip)
+		if err != nil {
+			return nil, fmt.Errorf("region skip %q: %v", r.Skip, err)
+		}
+	}
+
+	return &RegionRule{Start: start, End: end, Skip: skip, Group: r.Group}, nil
+}
+
+// candidate is an in-progress match against one of the syntax's rules,
+// used while picking the leftmost rule match on a line.
+type candidate struct {
+	start, end int
+	group      string
+	region     *RegionRule // non-nil if this candidate opens a region
+}
+
+// Highlight colorizes a single line according to syntax, given the state
+// left over from the previous line. While a region is open, a nested
+// region's Start still takes priority over the open region's own End if
+// it occurs first, so regions push/pop as a real stack rather than
+// topping out at depth one. It returns the spans for this line and the
+// state to pass in for the next line.
+func (syntax *Syntax) Highlight(line string, state *State) ([]Span, *State) {
+	if state == nil {
+		state = NewState()
+	}
+
+	var spans []Span
+	pos := 0
+
+	for pos <= len(line) {
+		if region := state.top(); region != nil {
+			end, endLen := findEnd(line[pos:], region)
+			endAbs := -1
+			if end >= 0 {
+				endAbs = pos + end
+			}
+
+			// A nested region (or, incidentally, a plain match) starting
+			// before this region's own End wins and gets pushed/emitted
+			// first; the region stays open underneath it on the stack.
+			// Candidates covered by this region's own Skip are escaped
+			// text, not real boundaries, so they're masked out the same
+			// way findEnd masks them for its own End match.
+			if c := nextUnmaskedCandidate(line, pos, syntax, region); c != nil && (endAbs < 0 || c.start < endAbs) {
+				if c.start > pos {
+					spans = append(spans, Span{Start: pos, End: c.start, Group: region.Group})
+				}
+				if c.region != nil {
+					state.push(c.region)
+					spans = append(spans, Span{Start: c.start, End: c.end, Group: c.region.Group})
+				} else {
+					spans = append(spans, Span{Start: c.start, End: c.end, Group: c.group})
+				}
+				pos = c.end
+				continue
+			}
+
+			if endAbs < 0 {
+				// Region stays open past the end of this line.
+				spans = append(spans, Span{Start: pos, End: len(line), Group: region.Group})
+				pos = len(line) + 1
+				continue
+			}
+
+			spans = append(spans, Span{Start: pos, End: endAbs + endLen, Group: region.Group})
+			pos = endAbs + endLen
+			state.pop()
+			continue
+		}
+
+		c := nextCandidate(line, pos, syntax)
+		if c == nil {
+			break
+		}
+
+		if c.region != nil {
+			state.push(c.region)
+			spans = append(spans, Span{Start: c.start, End: c.end, Group: c.region.Group})
+			pos = c.end
+			continue
+		}
+
+		spans = append(spans, Span{Start: c.start, End: c.end, Group: c.group})
+		pos = c.end
+	}
+
+	return spans, state
+}
+
+// findEnd locates the region's End match in rest, honoring Skip so an
+// escaped end sequence (e.g. skip `\\.` suppressing end `"` inside
+// `foo\"bar"`) doesn't close the region early. It returns the byte
+// offset of the match and its length, or (-1, 0) if End doesn't appear
+// in rest at all.
+func findEnd(rest string, region *RegionRule) (int, int) {
+	offset := 0
+	for {
+		loc := region.End.FindStringIndex(rest[offset:])
+		if loc == nil {
+			return -1, 0
+		}
+		endStart := loc[0]
+
+		if region.Skip != nil {
+			if skipLoc := findSkipCovering(rest[offset:], region.Skip, endStart); skipLoc != nil {
+				offset += skipLoc[1]
+				continue
+			}
+		}
+
+		return offset + endStart, loc[1] - loc[0]
+	}
+}
+
+// findSkipCovering returns the Skip match (if any) among every occurrence
+// in s whose span contains pos — an escape sequence straddling what
+// would otherwise look like an End match at pos.
+func findSkipCovering(s string, skip *regexp.Regexp, pos int) []int {
+	for _, loc := range skip.FindAllStringIndex(s, -1) {
+		if loc[0] > pos {
+			break
+		}
+		if loc[0] <= pos && pos < loc[1] {
+			return loc
+		}
+	}
+	return nil
+}
+
+// nextCandidate finds the leftmost match, among every match rule and
+// region-start rule, starting at or after pos. Ties are broken by rule
+// declaration order (matches first, then regions, mirroring Load order).
+func nextCandidate(line string, pos int, syntax *Syntax) *candidate {
+	var best *candidate
+
+	consider := func(loc []int, group string, region *RegionRule) {
+		if loc == nil {
+			return
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		if best == nil || start < best.start {
+			best = &candidate{start: start, end: end, group: group, region: region}
+		}
+	}
+
+	for _, m := range syntax.Matches {
+		consider(m.Regex.FindStringIndex(line[pos:]), m.Group, nil)
+	}
+	for i := range syntax.Regions {
+		region := &syntax.Regions[i]
+		consider(region.Start.FindStringIndex(line[pos:]), region.Group, region)
+	}
+
+	return best
+}
+
+// nextUnmaskedCandidate is like nextCandidate, but while open is an open
+// region with a Skip pattern, it ignores any candidate whose start falls
+// inside a Skip match — an escaped sequence isn't a real Start or End
+// boundary for anything, nested region included.
+func nextUnmaskedCandidate(line string, pos int, syntax *Syntax, open *RegionRule) *candidate {
+	for {
+		c := nextCandidate(line, pos, syntax)
+		if c == nil || open.Skip == nil {
+			return c
+		}
+		skipLoc := findSkipCovering(line[pos:], open.Skip, c.start-pos)
+		if skipLoc == nil {
+			return c
+		}
+		pos += skipLoc[1]
+	}
+}
@@ -0,0 +1,107 @@
+package highlight
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestHighlightMatch(t *testing.T) {
+	syntax := &Syntax{
+		Matches: []MatchRule{
+			{Regex: regexp.MustCompile(`TODO`), Group: "todo"},
+		},
+	}
+
+	spans, _ := syntax.Highlight("// TODO: fix this", NewState())
+	want := []Span{{Start: 3, End: 7, Group: "todo"}}
+	if !reflect.DeepEqual(spans, want) {
+		t.Fatalf("spans = %v, want %v", spans, want)
+	}
+}
+
+func TestHighlightRegionAcrossLines(t *testing.T) {
+	syntax := &Syntax{
+		Regions: []RegionRule{
+			{Start: regexp.MustCompile(`/\*`), End: regexp.MustCompile(`\*/`), Group: "comment"},
+		},
+	}
+
+	state := NewState()
+
+	spans, state := syntax.Highlight("code /* start of comment", state)
+	want := []Span{{Start: 5, End: 7, Group: "comment"}, {Start: 7, End: 24, Group: "comment"}}
+	if !reflect.DeepEqual(spans, want) {
+		t.Fatalf("line 1 spans = %v, want %v", spans, want)
+	}
+	if state.top() == nil {
+		t.Fatal("region should still be open after line 1")
+	}
+
+	spans, state = syntax.Highlight("still in comment", state)
+	want = []Span{{Start: 0, End: 16, Group: "comment"}}
+	if !reflect.DeepEqual(spans, want) {
+		t.Fatalf("line 2 spans = %v, want %v", spans, want)
+	}
+	if state.top() == nil {
+		t.Fatal("region should still be open after line 2")
+	}
+
+	spans, state = syntax.Highlight("end of comment */ code", state)
+	want = []Span{{Start: 0, End: 17, Group: "comment"}}
+	if !reflect.DeepEqual(spans, want) {
+		t.Fatalf("line 3 spans = %v, want %v", spans, want)
+	}
+	if state.top() != nil {
+		t.Fatal("region should be closed after line 3")
+	}
+}
+
+func TestHighlightRegionSkip(t *testing.T) {
+	syntax := &Syntax{
+		Regions: []RegionRule{
+			{
+				Start: regexp.MustCompile(`"`),
+				End:   regexp.MustCompile(`"`),
+				Skip:  regexp.MustCompile(`\\.`),
+				Group: "string",
+			},
+		},
+	}
+
+	// The first `"` after the escaped `\"` must NOT close the region, nor
+	// be mistaken for a nested region start; only the final, unescaped
+	// `"` should close it.
+	spans, state := syntax.Highlight(`"foo\"bar"`, NewState())
+	want := []Span{{Start: 0, End: 1, Group: "string"}, {Start: 1, End: 10, Group: "string"}}
+	if !reflect.DeepEqual(spans, want) {
+		t.Fatalf("spans = %v, want %v", spans, want)
+	}
+	if state.top() != nil {
+		t.Fatal("region should be closed once the real closing quote is seen")
+	}
+}
+
+func TestHighlightNestedRegions(t *testing.T) {
+	syntax := &Syntax{
+		Regions: []RegionRule{
+			{Start: regexp.MustCompile(`\(`), End: regexp.MustCompile(`\)`), Group: "paren"},
+			{Start: regexp.MustCompile(`\[`), End: regexp.MustCompile(`\]`), Group: "bracket"},
+		},
+	}
+
+	spans, state := syntax.Highlight(`(a [b] c)`, NewState())
+	want := []Span{
+		{Start: 0, End: 1, Group: "paren"},
+		{Start: 1, End: 3, Group: "paren"},
+		{Start: 3, End: 4, Group: "bracket"},
+		{Start: 4, End: 6, Group: "bracket"},
+		{Start: 6, End: 9, Group: "paren"},
+	}
+	if !reflect.DeepEqual(spans, want) {
+		t.Fatalf("spans = %v, want %v", spans, want)
+	}
+	if state.top() != nil {
+		t.Fatal("both regions should be closed by end of line")
+	}
+}